@@ -0,0 +1,149 @@
+// Package cache provides an optional Redis-backed cache for expensive,
+// read-heavy query results. All operations degrade gracefully: if Redis is
+// unreachable, callers should treat the result the same as a cache miss and
+// fall back to the source of truth.
+package cache
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Config holds the settings needed to connect to Redis and the default TTL
+// for cached entries.
+type Config struct {
+	Host     string
+	Port     string
+	Password string
+	TTL      time.Duration
+}
+
+// ConfigFromEnv builds a Config from environment variables.
+func ConfigFromEnv() Config {
+	return Config{
+		Host:     getEnv("CACHE_HOST", "localhost"),
+		Port:     getEnv("CACHE_PORT", "6379"),
+		Password: getEnv("CACHE_PASSWORD", ""),
+		TTL:      getEnvDuration("CACHE_TTL", 5*time.Minute),
+	}
+}
+
+// Cache wraps a Redis client. A nil or unreachable client disables caching
+// without requiring callers to special-case it.
+type Cache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// New connects to Redis using cfg. If the ping fails, caching is disabled
+// and every Get/Set becomes a no-op rather than an error, so startup never
+// fails just because Redis is down.
+func New(cfg Config) *Cache {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Host + ":" + cfg.Port,
+		Password: cfg.Password,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("Cache disabled: could not reach Redis at %s: %v", cfg.Host+":"+cfg.Port, err)
+		return &Cache{ttl: cfg.TTL}
+	}
+
+	return &Cache{client: client, ttl: cfg.TTL}
+}
+
+// Enabled reports whether a working Redis connection is available.
+func (c *Cache) Enabled() bool {
+	return c != nil && c.client != nil
+}
+
+// Get returns the cached value for key. The second return value is false on
+// a miss, a disabled cache, or a Redis error.
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool) {
+	if !c.Enabled() {
+		return nil, false
+	}
+
+	value, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Cache get error for key %q: %v", key, err)
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+// Set writes value under key with the configured TTL. Errors are logged and
+// otherwise swallowed, since a failed write-through should not fail the
+// request it's caching.
+func (c *Cache) Set(ctx context.Context, key string, value []byte) {
+	if !c.Enabled() {
+		return
+	}
+
+	if err := c.client.Set(ctx, key, value, c.ttl).Err(); err != nil {
+		log.Printf("Cache set error for key %q: %v", key, err)
+	}
+}
+
+// InvalidatePrefix deletes every cached key starting with prefix. Used by
+// the admin invalidate endpoint after a re-import of visit data makes
+// cached results stale.
+//
+// It walks the keyspace with SCAN rather than KEYS: KEYS blocks the
+// single-threaded Redis server for the duration of a full keyspace scan,
+// which would freeze every other caller each time this runs.
+func (c *Cache) InvalidatePrefix(ctx context.Context, prefix string) error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	var cursor uint64
+	for {
+		keys, nextCursor, err := c.client.Scan(ctx, cursor, prefix+"*", 100).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if err := c.client.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+		}
+
+		cursor = nextCursor
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,94 @@
+// Package db manages the lifecycle of the application's Postgres connection
+// pool.
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"database/sql"
+)
+
+// Config holds the settings needed to open and tune the connection pool.
+type Config struct {
+	Host            string
+	Port            string
+	User            string
+	Password        string
+	Name            string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// ConfigFromEnv builds a Config from environment variables, falling back to
+// the same defaults the service has always used.
+func ConfigFromEnv() Config {
+	return Config{
+		Host:            getEnv("DB_HOST", "postgres"),
+		Port:            getEnv("DB_PORT", "5432"),
+		User:            getEnv("DB_USER", "travelrecap"),
+		Password:        getEnv("DB_PASSWORD", "travelrecap_password"),
+		Name:            getEnv("DB_NAME", "travelrecap"),
+		MaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 25),
+		ConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+	}
+}
+
+// Open opens a *sql.DB for cfg, applies the pool settings, and verifies
+// connectivity with a ping before returning. The returned pool is intended
+// to be opened once in main and shared across requests.
+func Open(cfg Config) (*sql.DB, error) {
+	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name)
+
+	database, err := sql.Open("postgres", psqlInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	database.SetMaxOpenConns(cfg.MaxOpenConns)
+	database.SetMaxIdleConns(cfg.MaxIdleConns)
+	database.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := database.PingContext(ctx); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	return database, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
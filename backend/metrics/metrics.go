@@ -0,0 +1,150 @@
+// Package metrics exposes the Prometheus instrumentation for the API:
+// request counts and latencies, database query latencies, pool occupancy,
+// and result-set size.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// HTTPRequestsTotal counts completed HTTP requests by route, method and
+	// status code.
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total number of HTTP requests.",
+	}, []string{"route", "method", "status"})
+
+	// HTTPRequestDuration tracks how long requests take to serve.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request duration in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// DBQueryDuration tracks how long named queries take against Postgres.
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Database query duration in seconds, by query name.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query"})
+
+	// PlaceLocationsReturned records the size of the most recent
+	// place-locations result read from the database, independent of the
+	// HTTP request/response cycle's own metrics. Responses served from the
+	// cache do not update it.
+	PlaceLocationsReturned = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "place_locations_returned",
+		Help: "Number of place locations returned by the most recent query.",
+	})
+)
+
+// unmatchedRoute labels requests that didn't match any registered pattern
+// (e.g. a scanner probing random paths), so they don't each mint their own
+// http_requests_total/http_request_duration_seconds label combination.
+const unmatchedRoute = "unmatched"
+
+// Middleware records HTTPRequestsTotal and HTTPRequestDuration for every
+// request that passes through it, labeled by the registered route pattern
+// (via mux.Handler) rather than the raw path, so unmatched paths collapse
+// into unmatchedRoute instead of each becoming their own label. The
+// recording happens in a defer, so a panicking handler is still counted
+// wherever this sits in the chain: placed ahead of (outside)
+// middleware.Recover, as in main, it sees the 500 that Recover writes;
+// placed inside it, the defer runs as the panic unwinds through this frame
+// and records a 500 because nothing was written.
+func Middleware(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := mux.Handler(r)
+			route := pattern
+			if route == "" {
+				route = unmatchedRoute
+			}
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+
+			defer func() {
+				status := rec.status
+				if status == 0 {
+					// WriteHeader/Write never ran, e.g. a panic unwound through
+					// this handler before it could respond.
+					status = http.StatusInternalServerError
+				}
+
+				duration := time.Since(start).Seconds()
+				statusLabel := strconv.Itoa(status)
+				HTTPRequestsTotal.WithLabelValues(route, r.Method, statusLabel).Inc()
+				HTTPRequestDuration.WithLabelValues(route, r.Method, statusLabel).Observe(duration)
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status != 0 {
+		return
+	}
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// ObserveDBQuery records how long the named query took to run. Callers wrap
+// a single db.QueryContext/db.ExecContext call, e.g.:
+//
+//	defer metrics.ObserveDBQuery("place_locations_by_year", time.Now())
+func ObserveDBQuery(name string, start time.Time) {
+	DBQueryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+}
+
+// dbStatsCollector reports database/sql pool occupancy on every scrape
+// rather than on a fixed interval, since sql.DB.Stats() is cheap and always
+// current.
+type dbStatsCollector struct {
+	db              *sql.DB
+	openConnections *prometheus.Desc
+}
+
+// NewDBStatsCollector returns a prometheus.Collector exposing
+// db_open_connections for pool. Register it once with
+// prometheus.MustRegister.
+func NewDBStatsCollector(pool *sql.DB) prometheus.Collector {
+	return &dbStatsCollector{
+		db: pool,
+		openConnections: prometheus.NewDesc(
+			"db_open_connections",
+			"Number of established connections in the database pool, both in use and idle.",
+			nil, nil,
+		),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openConnections
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.openConnections, prometheus.GaugeValue, float64(stats.OpenConnections))
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"travelrecap-backend/metrics"
+)
+
+// placeLocationsCacheKeyPrefix namespaces cached place-location query
+// results so the admin invalidate endpoint can flush just these entries.
+const placeLocationsCacheKeyPrefix = "place-locations:"
+
+const defaultPlaceLocationsLimit = 0 // 0 means unlimited, preserving the previous unpaginated behavior.
+
+type PlaceLocation struct {
+	Lat     float64 `json:"lat"`
+	Lng     float64 `json:"lng"`
+	City    *string `json:"city"`
+	Country *string `json:"country"`
+	PlaceID string  `json:"place_id"`
+}
+
+// GeoJSONFeatureCollection is a minimal GeoJSON FeatureCollection, enough
+// for map front-ends (Leaflet/Mapbox) to consume directly.
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// placeLocationsCacheEntry is what gets marshaled into the cache, so a cache
+// hit can still report an accurate X-Total-Count.
+type placeLocationsCacheEntry struct {
+	Total   int             `json:"total"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func placeLocationsToGeoJSON(locations []PlaceLocation) GeoJSONFeatureCollection {
+	features := make([]GeoJSONFeature, 0, len(locations))
+	for _, loc := range locations {
+		props := map[string]interface{}{"place_id": loc.PlaceID}
+		if loc.City != nil {
+			props["city"] = *loc.City
+		}
+		if loc.Country != nil {
+			props["country"] = *loc.Country
+		}
+		features = append(features, GeoJSONFeature{
+			Type:       "Feature",
+			Geometry:   GeoJSONGeometry{Type: "Point", Coordinates: [2]float64{loc.Lng, loc.Lat}},
+			Properties: props,
+		})
+	}
+	return GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+// boundingBox is a WGS84 lng/lat box, as passed via the bbox query param
+// ("minLng,minLat,maxLng,maxLat").
+type boundingBox struct {
+	minLng, minLat, maxLng, maxLat float64
+}
+
+func parseBoundingBox(raw string) (*boundingBox, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox must have 4 comma-separated values: minLng,minLat,maxLng,maxLat")
+	}
+
+	values := make([]float64, 4)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox value %q is not a number", part)
+		}
+		values[i] = v
+	}
+
+	bbox := &boundingBox{minLng: values[0], minLat: values[1], maxLng: values[2], maxLat: values[3]}
+	if bbox.minLng > bbox.maxLng || bbox.minLat > bbox.maxLat {
+		return nil, fmt.Errorf("bbox minLng/minLat must not be greater than maxLng/maxLat")
+	}
+
+	return bbox, nil
+}
+
+// placeLocationsParams is the parsed, validated form of the query string
+// accepted by placeLocationsHandler.
+type placeLocationsParams struct {
+	yearStart *int
+	yearEnd   *int
+	country   *string
+	city      *string
+	bbox      *boundingBox
+	limit     int
+	offset    int
+	geojson   bool
+}
+
+func parsePlaceLocationsParams(query url.Values) (placeLocationsParams, error) {
+	var p placeLocationsParams
+	p.limit = defaultPlaceLocationsLimit
+
+	parseYear := func(name string) (*int, error) {
+		raw := query.Get(name)
+		if raw == "" {
+			return nil, nil
+		}
+		year, err := strconv.Atoi(raw)
+		if err != nil || year < 1900 || year > 2100 {
+			return nil, fmt.Errorf("%s must be a valid year between 1900 and 2100", name)
+		}
+		return &year, nil
+	}
+
+	yearStart, err := parseYear("year_start")
+	if err != nil {
+		return p, err
+	}
+	yearEnd, err := parseYear("year_end")
+	if err != nil {
+		return p, err
+	}
+	// "year" is kept for backwards compatibility: a single year is just a
+	// range whose start and end are the same year.
+	year, err := parseYear("year")
+	if err != nil {
+		return p, err
+	}
+	if year != nil {
+		yearStart, yearEnd = year, year
+	}
+	if yearStart != nil && yearEnd != nil && *yearStart > *yearEnd {
+		return p, fmt.Errorf("year_start must not be after year_end")
+	}
+	p.yearStart, p.yearEnd = yearStart, yearEnd
+
+	if country := query.Get("country"); country != "" {
+		p.country = &country
+	}
+	if city := query.Get("city"); city != "" {
+		p.city = &city
+	}
+
+	if raw := query.Get("bbox"); raw != "" {
+		bbox, err := parseBoundingBox(raw)
+		if err != nil {
+			return p, err
+		}
+		p.bbox = bbox
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return p, fmt.Errorf("limit must be a positive integer")
+		}
+		p.limit = limit
+	}
+	if raw := query.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return p, fmt.Errorf("offset must be a non-negative integer")
+		}
+		p.offset = offset
+	}
+
+	p.geojson = query.Get("format") == "geojson"
+
+	return p, nil
+}
+
+// queryName identifies this parameter combination for the db_query_duration_seconds
+// metric: whether it needs the visits join for a year filter.
+func (p placeLocationsParams) queryName() string {
+	if p.yearStart != nil || p.yearEnd != nil {
+		return "place_locations_by_year"
+	}
+	return "place_locations_all"
+}
+
+// buildQueries returns the data query (with ORDER BY/LIMIT/OFFSET) and a
+// matching count query (filters only, no pagination), along with their
+// respective argument lists.
+func (p placeLocationsParams) buildQueries() (dataQuery string, dataArgs []interface{}, countQuery string, countArgs []interface{}) {
+	joinVisits := p.yearStart != nil || p.yearEnd != nil
+
+	from := "FROM place_locations pl"
+	if joinVisits {
+		from += " INNER JOIN visits v ON pl.place_id = v.place_id"
+	}
+
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if joinVisits {
+		conditions = append(conditions, "v.place_id IS NOT NULL")
+		if p.yearStart != nil {
+			start := time.Date(*p.yearStart, 1, 1, 0, 0, 0, 0, time.UTC)
+			conditions = append(conditions, "v.start_time >= "+arg(start))
+		}
+		if p.yearEnd != nil {
+			end := time.Date(*p.yearEnd+1, 1, 1, 0, 0, 0, 0, time.UTC)
+			conditions = append(conditions, "v.start_time < "+arg(end))
+		}
+	}
+	if p.country != nil {
+		conditions = append(conditions, "pl.country = "+arg(*p.country))
+	}
+	if p.city != nil {
+		conditions = append(conditions, "pl.city = "+arg(*p.city))
+	}
+	if p.bbox != nil {
+		conditions = append(conditions, "pl.lat BETWEEN "+arg(p.bbox.minLat)+" AND "+arg(p.bbox.maxLat))
+		conditions = append(conditions, "pl.lng BETWEEN "+arg(p.bbox.minLng)+" AND "+arg(p.bbox.maxLng))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	countArgs = append([]interface{}{}, args...)
+	if joinVisits {
+		countQuery = "SELECT COUNT(DISTINCT pl.place_id) " + from + where
+	} else {
+		countQuery = "SELECT COUNT(*) " + from + where
+	}
+
+	selectCols := "pl.lat, pl.lng, pl.city, pl.country, pl.place_id"
+	if joinVisits {
+		selectCols = "DISTINCT " + selectCols
+	}
+	dataQuery = "SELECT " + selectCols + " " + from + where + " ORDER BY pl.place_id"
+	if p.limit > 0 {
+		dataQuery += " LIMIT " + arg(p.limit)
+	}
+	if p.offset > 0 {
+		dataQuery += " OFFSET " + arg(p.offset)
+	}
+	dataArgs = args
+
+	return dataQuery, dataArgs, countQuery, countArgs
+}
+
+// PlaceLocationsHandler handles GET requests for place locations
+// @Summary Get place locations
+// @Description Get place locations, filterable by year (or year_start/year_end range), country, city, and a bounding box, with limit/offset pagination. Returns GeoJSON when format=geojson.
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param year query int false "Filter locations by year (e.g., 2023)"
+// @Param year_start query int false "Filter locations from this year onward"
+// @Param year_end query int false "Filter locations up to and including this year"
+// @Param country query string false "Filter locations by country"
+// @Param city query string false "Filter locations by city"
+// @Param bbox query string false "minLng,minLat,maxLng,maxLat bounding box"
+// @Param limit query int false "Maximum number of results"
+// @Param offset query int false "Number of results to skip"
+// @Param format query string false "Set to geojson for a FeatureCollection response"
+// @Success 200 {array} PlaceLocation "List of place locations"
+// @Failure 400 {object} map[string]string "Invalid query parameter"
+// @Failure 500 {object} map[string]string "Database error"
+// @Router /api/place-locations [get]
+func (s *Server) placeLocationsHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parsePlaceLocationsParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cacheKey := placeLocationsCacheKeyPrefix + r.URL.Query().Encode()
+	if cached, ok := s.cache.Get(r.Context(), cacheKey); ok {
+		var entry placeLocationsCacheEntry
+		err := json.Unmarshal(cached, &entry)
+		if err == nil {
+			w.Header().Set("Content-Type", placeLocationsContentType(params))
+			w.Header().Set("X-Total-Count", strconv.Itoa(entry.Total))
+			w.Write(entry.Payload)
+			return
+		}
+		log.Printf("Error decoding cached place locations for key %q: %v", cacheKey, err)
+	}
+
+	dataQuery, dataArgs, countQuery, countArgs := params.buildQueries()
+
+	var total int
+	if err := s.db.QueryRowContext(r.Context(), countQuery, countArgs...).Scan(&total); err != nil {
+		log.Printf("Error counting place_locations: %v", err)
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		return
+	}
+
+	queryStart := time.Now()
+	rows, err := s.db.QueryContext(r.Context(), dataQuery, dataArgs...)
+	metrics.ObserveDBQuery(params.queryName(), queryStart)
+	if err != nil {
+		log.Printf("Error querying place_locations: %v", err)
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var locations []PlaceLocation
+	for rows.Next() {
+		var loc PlaceLocation
+		if err := rows.Scan(&loc.Lat, &loc.Lng, &loc.City, &loc.Country, &loc.PlaceID); err != nil {
+			log.Printf("Error scanning row: %v", err)
+			continue
+		}
+		locations = append(locations, loc)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating rows: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	metrics.PlaceLocationsReturned.Set(float64(len(locations)))
+
+	var payload []byte
+	if params.geojson {
+		payload, err = json.Marshal(placeLocationsToGeoJSON(locations))
+	} else {
+		payload, err = json.Marshal(locations)
+	}
+	if err != nil {
+		log.Printf("Error marshaling place locations: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if entryPayload, err := json.Marshal(placeLocationsCacheEntry{Total: total, Payload: payload}); err != nil {
+		log.Printf("Error marshaling cache entry: %v", err)
+	} else {
+		s.cache.Set(r.Context(), cacheKey, entryPayload)
+	}
+
+	w.Header().Set("Content-Type", placeLocationsContentType(params))
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Write(payload)
+}
+
+func placeLocationsContentType(p placeLocationsParams) string {
+	if p.geojson {
+		return "application/geo+json"
+	}
+	return "application/json"
+}
+
+// invalidateCacheHandler flushes cached place-location results so a fresh
+// import of visit data is reflected immediately. It requires the
+// X-Admin-Secret header to match the CACHE_ADMIN_SECRET env var.
+// @Summary Invalidate the place-location cache
+// @Description Flushes all cached place-location query results. Requires a matching X-Admin-Secret header.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]string "ok"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Cache error"
+// @Router /api/cache/invalidate [post]
+func (s *Server) invalidateCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := getEnv("CACHE_ADMIN_SECRET", "")
+	given := r.Header.Get("X-Admin-Secret")
+	if secret == "" || subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.cache.InvalidatePrefix(r.Context(), placeLocationsCacheKeyPrefix); err != nil {
+		log.Printf("Error invalidating cache: %v", err)
+		http.Error(w, "Cache error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "invalidated"})
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"travelrecap-backend/metrics"
+)
+
+const (
+	defaultClusterEpsKm     = 50.0
+	defaultClusterMinPoints = 2
+	earthRadiusKm           = 6371.0
+)
+
+// CountryVisitSummary is the visit count for a single country.
+type CountryVisitSummary struct {
+	Country    string `json:"country"`
+	VisitCount int    `json:"visit_count"`
+}
+
+// CityVisitSummary is the visit count for a single city.
+type CityVisitSummary struct {
+	City       string `json:"city"`
+	Country    string `json:"country"`
+	VisitCount int    `json:"visit_count"`
+}
+
+// VisitsSummary is the response for GET /api/visits/summary.
+type VisitsSummary struct {
+	TotalDistinctDays int                   `json:"total_distinct_days"`
+	ByCountry         []CountryVisitSummary `json:"by_country"`
+	ByCity            []CityVisitSummary    `json:"by_city"`
+}
+
+// parseOptionalYear parses the "year" query param, if present, applying the
+// same 1900-2100 bound used by placeLocationsHandler.
+func parseOptionalYear(query map[string][]string) (*int, error) {
+	values := query["year"]
+	if len(values) == 0 || values[0] == "" {
+		return nil, nil
+	}
+	year, err := strconv.Atoi(values[0])
+	if err != nil || year < 1900 || year > 2100 {
+		return nil, fmt.Errorf("year must be a valid year between 1900 and 2100")
+	}
+	return &year, nil
+}
+
+// visitsSummaryHandler handles GET requests for per-country and per-city
+// visit counts and total distinct days visited.
+// @Summary Get visit summary
+// @Description Get per-country and per-city visit counts and total distinct days visited, optionally filtered by year.
+// @Tags visits
+// @Produce json
+// @Param year query int false "Filter visits by year (e.g., 2023)"
+// @Success 200 {object} VisitsSummary "Visit summary"
+// @Failure 400 {object} map[string]string "Invalid year parameter"
+// @Failure 500 {object} map[string]string "Database error"
+// @Router /api/visits/summary [get]
+func (s *Server) visitsSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	year, err := parseOptionalYear(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var yearCondition string
+	var args []interface{}
+	if year != nil {
+		startTime := time.Date(*year, 1, 1, 0, 0, 0, 0, time.UTC)
+		endTime := time.Date(*year+1, 1, 1, 0, 0, 0, 0, time.UTC)
+		yearCondition = " AND v.start_time >= $1 AND v.start_time < $2"
+		args = []interface{}{startTime, endTime}
+	}
+
+	summary := VisitsSummary{}
+
+	countryStart := time.Now()
+	countryRows, err := s.db.QueryContext(r.Context(), `
+		SELECT pl.country, COUNT(*)
+		FROM visits v
+		INNER JOIN place_locations pl ON pl.place_id = v.place_id
+		WHERE v.place_id IS NOT NULL AND pl.country IS NOT NULL`+yearCondition+`
+		GROUP BY pl.country
+		ORDER BY pl.country
+	`, args...)
+	metrics.ObserveDBQuery("visits_summary_by_country", countryStart)
+	if err != nil {
+		log.Printf("Error querying visits by country: %v", err)
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		return
+	}
+	defer countryRows.Close()
+
+	for countryRows.Next() {
+		var row CountryVisitSummary
+		if err := countryRows.Scan(&row.Country, &row.VisitCount); err != nil {
+			log.Printf("Error scanning country summary row: %v", err)
+			continue
+		}
+		summary.ByCountry = append(summary.ByCountry, row)
+	}
+	if err := countryRows.Err(); err != nil {
+		log.Printf("Error iterating country summary rows: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	cityStart := time.Now()
+	cityRows, err := s.db.QueryContext(r.Context(), `
+		SELECT pl.city, pl.country, COUNT(*)
+		FROM visits v
+		INNER JOIN place_locations pl ON pl.place_id = v.place_id
+		WHERE v.place_id IS NOT NULL AND pl.city IS NOT NULL`+yearCondition+`
+		GROUP BY pl.city, pl.country
+		ORDER BY pl.city
+	`, args...)
+	metrics.ObserveDBQuery("visits_summary_by_city", cityStart)
+	if err != nil {
+		log.Printf("Error querying visits by city: %v", err)
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		return
+	}
+	defer cityRows.Close()
+
+	for cityRows.Next() {
+		var row CityVisitSummary
+		if err := cityRows.Scan(&row.City, &row.Country, &row.VisitCount); err != nil {
+			log.Printf("Error scanning city summary row: %v", err)
+			continue
+		}
+		summary.ByCity = append(summary.ByCity, row)
+	}
+	if err := cityRows.Err(); err != nil {
+		log.Printf("Error iterating city summary rows: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	daysStart := time.Now()
+	daysQuery := `SELECT COUNT(DISTINCT v.start_time::date) FROM visits v WHERE v.place_id IS NOT NULL` + yearCondition
+	if err := s.db.QueryRowContext(r.Context(), daysQuery, args...).Scan(&summary.TotalDistinctDays); err != nil {
+		log.Printf("Error counting distinct visit days: %v", err)
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		return
+	}
+	metrics.ObserveDBQuery("visits_summary_distinct_days", daysStart)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// clusterPoint is the subset of PlaceLocation fields DBSCAN needs.
+type clusterPoint struct {
+	PlaceID string
+	Lat     float64
+	Lng     float64
+}
+
+// BoundingBox is the lat/lng extent of a trip cluster.
+type BoundingBox struct {
+	MinLat float64 `json:"min_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLng float64 `json:"max_lng"`
+}
+
+// Cluster is a group of nearby place locations, as produced by dbscan.
+type Cluster struct {
+	CentroidLat float64     `json:"centroid_lat"`
+	CentroidLng float64     `json:"centroid_lng"`
+	PlaceIDs    []string    `json:"place_ids"`
+	BoundingBox BoundingBox `json:"bounding_box"`
+}
+
+// VisitClustersResponse is the response for GET /api/visits/clusters.
+type VisitClustersResponse struct {
+	Clusters []Cluster `json:"clusters"`
+}
+
+// haversineKm returns the great-circle distance between two lat/lng points,
+// in kilometers.
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return earthRadiusKm * c
+}
+
+// dbscan clusters points by great-circle distance. points must already be
+// sorted by PlaceID so that tie-breaking (which point starts a cluster,
+// iteration order of neighbors) is deterministic across runs. Returns a
+// cluster label per point: 0-based cluster index, or -1 for noise.
+func dbscan(points []clusterPoint, epsKm float64, minPoints int) []int {
+	const unvisited = -2
+	const noise = -1
+
+	labels := make([]int, len(points))
+	for i := range labels {
+		labels[i] = unvisited
+	}
+
+	regionQuery := func(i int) []int {
+		var neighbors []int
+		for j := range points {
+			if haversineKm(points[i].Lat, points[i].Lng, points[j].Lat, points[j].Lng) <= epsKm {
+				neighbors = append(neighbors, j)
+			}
+		}
+		return neighbors
+	}
+
+	nextCluster := 0
+	for i := range points {
+		if labels[i] != unvisited {
+			continue
+		}
+
+		neighbors := regionQuery(i)
+		if len(neighbors) < minPoints {
+			labels[i] = noise
+			continue
+		}
+
+		cluster := nextCluster
+		nextCluster++
+		labels[i] = cluster
+
+		queue := append([]int{}, neighbors...)
+		for len(queue) > 0 {
+			j := queue[0]
+			queue = queue[1:]
+
+			if labels[j] == noise {
+				labels[j] = cluster
+			}
+			if labels[j] != unvisited {
+				continue
+			}
+			labels[j] = cluster
+
+			jNeighbors := regionQuery(j)
+			if len(jNeighbors) >= minPoints {
+				queue = append(queue, jNeighbors...)
+			}
+		}
+	}
+
+	return labels
+}
+
+// buildClusters groups points by the labels dbscan produced into density
+// centroids with a bounding box. Noise points (label -1) are dropped.
+func buildClusters(points []clusterPoint, labels []int) []Cluster {
+	byCluster := map[int][]clusterPoint{}
+	for i, label := range labels {
+		if label < 0 {
+			continue
+		}
+		byCluster[label] = append(byCluster[label], points[i])
+	}
+
+	clusterIDs := make([]int, 0, len(byCluster))
+	for id := range byCluster {
+		clusterIDs = append(clusterIDs, id)
+	}
+	sort.Ints(clusterIDs)
+
+	clusters := make([]Cluster, 0, len(clusterIDs))
+	for _, id := range clusterIDs {
+		members := byCluster[id]
+
+		var sumLat, sumLng float64
+		bbox := BoundingBox{MinLat: members[0].Lat, MaxLat: members[0].Lat, MinLng: members[0].Lng, MaxLng: members[0].Lng}
+		placeIDs := make([]string, 0, len(members))
+		for _, m := range members {
+			sumLat += m.Lat
+			sumLng += m.Lng
+			placeIDs = append(placeIDs, m.PlaceID)
+			bbox.MinLat = math.Min(bbox.MinLat, m.Lat)
+			bbox.MaxLat = math.Max(bbox.MaxLat, m.Lat)
+			bbox.MinLng = math.Min(bbox.MinLng, m.Lng)
+			bbox.MaxLng = math.Max(bbox.MaxLng, m.Lng)
+		}
+
+		clusters = append(clusters, Cluster{
+			CentroidLat: sumLat / float64(len(members)),
+			CentroidLng: sumLng / float64(len(members)),
+			PlaceIDs:    placeIDs,
+			BoundingBox: bbox,
+		})
+	}
+
+	return clusters
+}
+
+// visitsClustersHandler handles GET requests that server-side cluster place
+// locations with a simple haversine-distance DBSCAN, so the front-end can
+// draw trip regions instead of overwhelming the map with pins.
+// @Summary Get trip clusters
+// @Description Clusters place locations by great-circle distance (DBSCAN), optionally filtered by year.
+// @Tags visits
+// @Produce json
+// @Param year query int false "Filter locations by year (e.g., 2023)"
+// @Param eps_km query number false "Cluster radius in kilometers (default 50)"
+// @Param min_points query int false "Minimum points to form a cluster (default 2)"
+// @Success 200 {object} VisitClustersResponse "Trip clusters"
+// @Failure 400 {object} map[string]string "Invalid query parameter"
+// @Failure 500 {object} map[string]string "Database error"
+// @Router /api/visits/clusters [get]
+func (s *Server) visitsClustersHandler(w http.ResponseWriter, r *http.Request) {
+	year, err := parseOptionalYear(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	epsKm := defaultClusterEpsKm
+	if raw := r.URL.Query().Get("eps_km"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "eps_km must be a positive number", http.StatusBadRequest)
+			return
+		}
+		epsKm = parsed
+	}
+
+	minPoints := defaultClusterMinPoints
+	if raw := r.URL.Query().Get("min_points"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			http.Error(w, "min_points must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		minPoints = parsed
+	}
+
+	// Reuse placeLocationsParams' query builder so clustering sees exactly
+	// the rows the regular endpoint would return for the same year, already
+	// ordered by place_id for deterministic tie-breaking.
+	params := placeLocationsParams{yearStart: year, yearEnd: year}
+	dataQuery, dataArgs, _, _ := params.buildQueries()
+
+	queryStart := time.Now()
+	rows, err := s.db.QueryContext(r.Context(), dataQuery, dataArgs...)
+	metrics.ObserveDBQuery("visits_clusters_locations", queryStart)
+	if err != nil {
+		log.Printf("Error querying place_locations for clustering: %v", err)
+		http.Error(w, "Database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var points []clusterPoint
+	for rows.Next() {
+		var loc PlaceLocation
+		if err := rows.Scan(&loc.Lat, &loc.Lng, &loc.City, &loc.Country, &loc.PlaceID); err != nil {
+			log.Printf("Error scanning row: %v", err)
+			continue
+		}
+		points = append(points, clusterPoint{PlaceID: loc.PlaceID, Lat: loc.Lat, Lng: loc.Lng})
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating rows: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	labels := dbscan(points, epsKm, minPoints)
+	clusters := buildClusters(points, labels)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VisitClustersResponse{Clusters: clusters})
+}